@@ -5,7 +5,7 @@ Licensed under the Apache License, Version 2.0 (the "License");
 you may not use this file except in compliance with the License.
 You may obtain a copy of the License at
 
-    http://www.apache.org/licenses/LICENSE-2.0
+	http://www.apache.org/licenses/LICENSE-2.0
 
 Unless required by applicable law or agreed to in writing, software
 distributed under the License is distributed on an "AS IS" BASIS,
@@ -17,21 +17,23 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"golang.org/x/oauth2"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/google/go-github/github"
 	"github.com/pepper/mygithub"
+	"github.com/pepper/policy"
+	"github.com/pepper/report"
 )
 
 const (
@@ -42,36 +44,42 @@ const (
 )
 
 var (
-	token  string
-	enturl string
-	org    string
-	nouser bool
-	dryrun bool
-
-	debug      bool
-	version    bool
-	exceptions map[string]stringSlice
+	token      string
+	enturl     string
+	org        string
+	policyFile string
+	nouser     bool
+	dryrun     bool
+
+	appID          int64
+	privateKey     string
+	installationID int64
+
+	workers int
+
+	reportFile   string
+	reportFormat string
+
+	debug   bool
+	version bool
+	pol     *policy.Policy
+	rpt     *report.Report
 )
 
-// stringSlice is a slice of strings
-type stringSlice []string
-
-// implement the flag interface for stringSlice
-func (s *stringSlice) String() string {
-	return fmt.Sprintf("%s", *s)
-}
-func (s *stringSlice) Set(value string) error {
-	*s = append(*s, value)
-	return nil
-}
-
 func init() {
 	// parse flags
 	flag.StringVar(&token, "token", "", "GitHub API token")
+	flag.Int64Var(&appID, "app-id", 0, "GitHub App ID (alternative to --token)")
+	flag.StringVar(&privateKey, "private-key", "", "path to the GitHub App's RSA private key (required with --app-id)")
+	flag.Int64Var(&installationID, "installation-id", 0, "GitHub App installation ID to authenticate as (omit to sweep every installation of the App)")
 	flag.StringVar(&enturl, "url", "", "GitHub Enterprise URL")
 	flag.StringVar(&org, "org", "", "organization to include")
+	flag.StringVar(&policyFile, "policy", "policy.yaml", "path to the branch protection policy file")
 	flag.BoolVar(&nouser, "nouser", false, "do not include your user")
 	flag.BoolVar(&dryrun, "dry-run", false, "do not change branch settings just print the changes that would occur")
+	flag.IntVar(&workers, "workers", 1, "number of repos to process concurrently")
+	flag.StringVar(&reportFile, "report", "", "write a machine-readable drift report to this file instead of changing anything (implies --dry-run)")
+	flag.StringVar(&reportFormat, "format", "json", "report format when --report is set: json, csv, or sarif")
 
 	flag.BoolVar(&version, "version", false, "print version and exit")
 	flag.BoolVar(&version, "v", false, "print version and exit (shorthand)")
@@ -81,7 +89,13 @@ func init() {
 		fmt.Fprint(os.Stderr, fmt.Sprintf(BANNER, VERSION))
 		flag.PrintDefaults()
 	}
+}
 
+// parseFlags parses the command line, applies --version/--dry-run-implying
+// side effects, and validates the flag combination. It is called from main
+// rather than folded into init, so that `go test` (which has its own flags)
+// doesn't trip over flag.Parse() running before any test gets to run.
+func parseFlags() {
 	flag.Parse()
 
 	if version {
@@ -94,28 +108,49 @@ func init() {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 
-	if token == "" {
-		usageAndExit("GitHub token cannot be empty.", 1)
+	if token == "" && (appID == 0 || privateKey == "") {
+		usageAndExit("either --token or --app-id/--private-key must be provided.", 1)
 	}
 
-	if nouser && org == "" {
+	if token != "" && nouser && org == "" {
 		usageAndExit("no organizations provided", 1)
 	}
-	file, e := ioutil.ReadFile("./exception-repos.json")
-	if e != nil {
-		fmt.Printf("File error: %v\n", e)
-		os.Exit(1)
+
+	if workers < 1 {
+		usageAndExit("--workers must be at least 1", 1)
+	}
+
+	if reportFile != "" {
+		switch reportFormat {
+		case "json", "csv", "sarif":
+		default:
+			usageAndExit(fmt.Sprintf("unknown --format %q (want json, csv, or sarif)", reportFormat), 1)
+		}
+		rpt = report.New()
+		dryrun = true
 	}
-	e = json.Unmarshal(file, &exceptions)
+
+	var e error
+	pol, e = policy.Load(policyFile)
 	if e != nil {
-		fmt.Printf("Json error: %v\n", e)
+		fmt.Printf("Policy error: %v\n", e)
 		os.Exit(1)
 	}
 }
 
 type fn func(context.Context, *github.Client, *mygithub.MyClient, string, int, int) (int, error)
 
+// installation pairs an oauth2.TokenSource with the account it authenticates
+// as, when known in advance (GitHub App auth ties a token to one account;
+// a plain PAT does not).
+type installation struct {
+	account string
+	oauth2.TokenSource
+}
+
 func main() {
+	parseFlags()
+
 	// On ^C, or SIGTERM handle exit.
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
@@ -127,11 +162,88 @@ func main() {
 		}
 	}()
 
-	// Create the http client.
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(oauth2.NoContext, ts)
+	installations, err := resolveInstallations()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	for _, inst := range installations {
+		sweep(inst)
+	}
+
+	if rpt != nil {
+		if err := writeReport(); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+}
+
+// writeReport renders the accumulated drift report to --report in
+// --format.
+func writeReport() error {
+	f, err := os.Create(reportFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return rpt.Write(f, reportFormat)
+}
+
+// resolveInstallations builds the list of accounts to sweep and the
+// credentials to use for each. A PAT always yields a single, unnamed
+// installation; GitHub App credentials yield one installation per
+// `--installation-id`, or one per installation the App is on when
+// `--installation-id` is omitted.
+func resolveInstallations() ([]installation, error) {
+	if token != "" {
+		ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+		return []installation{{TokenSource: ts}}, nil
+	}
+
+	cfg := mygithub.AppConfig{AppID: appID, PrivateKeyPath: privateKey}
+	if enturl != "" {
+		cfg.BaseURL = enturl + "/api/v3/"
+	}
+
+	if installationID != 0 {
+		cfg.InstallationID = installationID
+		app, err := mygithub.GetInstallation(cfg, nil)
+		if err != nil {
+			return nil, fmt.Errorf("resolving installation %d: %v", installationID, err)
+		}
+		its, err := mygithub.NewInstallationTokenSource(cfg, nil)
+		if err != nil {
+			return nil, err
+		}
+		return []installation{{
+			account:     app.Account.Login,
+			TokenSource: oauth2.ReuseTokenSource(nil, its),
+		}}, nil
+	}
+
+	apps, err := mygithub.ListInstallations(cfg, nil)
+	if err != nil {
+		return nil, fmt.Errorf("auto-discovering installations: %v", err)
+	}
+	installations := make([]installation, 0, len(apps))
+	for _, app := range apps {
+		instCfg := cfg
+		instCfg.InstallationID = app.ID
+		its, err := mygithub.NewInstallationTokenSource(instCfg, nil)
+		if err != nil {
+			return nil, err
+		}
+		installations = append(installations, installation{
+			account:     app.Account.Login,
+			TokenSource: oauth2.ReuseTokenSource(nil, its),
+		})
+	}
+	return installations, nil
+}
+
+// sweep runs one full repo/branch sweep authenticated as inst.
+func sweep(inst installation) {
+	tc := oauth2.NewClient(oauth2.NoContext, inst.TokenSource)
 
 	// Create the github client.
 	client := github.NewClient(tc)
@@ -143,6 +255,12 @@ func main() {
 		}
 	}
 
+	// A GitHub App installation is already scoped to one account.
+	if inst.account != "" {
+		updateRepositories(client, inst.account, getRepositoriesByOrg)
+		return
+	}
+
 	if !nouser {
 		// Get the current user
 		user, _, err := client.Users.Get(context.Background(), "")
@@ -200,14 +318,25 @@ func getRepositoriesByOrg(ctx context.Context, client *github.Client, myClient *
 }
 
 func handleRepoAndNext(ctx context.Context, client *github.Client, myClient *mygithub.MyClient, subject string, repos []*github.Repository, page int, resp *github.Response) (int, error) {
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
 	for _, repo := range repos {
-		if subject != *repo.Owner.Login || in(exceptions["exceptions"], *repo.FullName) {
+		if subject != *repo.Owner.Login || pol.Excluded(*repo.FullName) {
 			continue
 		}
-		if err := handleRepo(ctx, client, myClient, repo); err != nil {
-			logrus.Warn(err)
-		}
+		repo := repo
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := handleRepo(ctx, client, myClient, repo); err != nil {
+				logrus.Warn(err)
+			}
+		}()
 	}
+	wg.Wait()
 
 	// Return early if we are on the last page.
 	if page == resp.LastPage || resp.NextPage == 0 {
@@ -220,63 +349,364 @@ func handleRepoAndNext(ctx context.Context, client *github.Client, myClient *myg
 // handleRepo will return nil error if the user does not have access to something.
 func handleRepo(ctx context.Context, client *github.Client, myClient *mygithub.MyClient, repo *github.Repository) error {
 	fmt.Println(*repo.FullName)
-	fmt.Println(*repo.DefaultBranch)
-	branch, resp, err := client.Repositories.GetBranch(ctx, *repo.Owner.Login, *repo.Name, *repo.DefaultBranch)
-	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden {
+
+	rule, ok := pol.Resolve(repo)
+	if !ok {
+		fmt.Printf("[SKIP] %s matches no policy rule\n", *repo.FullName)
 		return nil
 	}
+
+	if err := handleRepoSettings(ctx, myClient, repo, rule); err != nil {
+		logrus.Warn(err)
+	}
+
+	branches, err := matchingBranches(ctx, client, myClient, repo, rule)
 	if err != nil {
 		return err
 	}
-	return handleBranch(ctx, client, myClient, repo, branch)
+	if len(branches) == 0 {
+		fmt.Printf("[SKIP] %s: no branch matches the policy\n", *repo.FullName)
+		return nil
+	}
+
+	for _, branch := range branches {
+		if err := handleBranch(ctx, myClient, repo, branch, rule); err != nil {
+			logrus.Warn(err)
+		}
+	}
+	return nil
 }
 
-func handleBranch(ctx context.Context, client *github.Client, myClient *mygithub.MyClient, repo *github.Repository, branch *github.Branch) error {
-	protectionRequest := &mygithub.CdisProtectionRequest{
-		RequiredStatusChecks: nil,
-		// &github.RequiredStatusChecks{
-		// 	Strict:   true,
-		// 	Contexts: []string{"continuous-integration/travis-ci", "codacy/pr"},
-		// },
-		RequiredPullRequestReviews: &mygithub.PullRequestReviewsEnforcementRequest{
-			DismissStaleReviews:     false,
-			RequireCodeOwnerReviews: true,
-		},
-		EnforceAdmins: true,
-		// TODO: Only organization repositories can have users and team restrictions.
-		//       In order to be able to test these Restrictions, need to add support
-		//       for creating temporary organization repositories.
-		Restrictions: nil,
+// matchingBranches returns the branches of repo that rule's protection
+// should apply to: the repo's default branch when rule declares no branch
+// selectors (pepper's original behavior), or every branch matching one of
+// rule.Branches otherwise.
+func matchingBranches(ctx context.Context, client *github.Client, myClient *mygithub.MyClient, repo *github.Repository, rule *policy.Rule) ([]*github.Branch, error) {
+	if len(rule.Branches) == 0 {
+		fmt.Println(*repo.DefaultBranch)
+		branch, resp, err := getBranchWithRetry(ctx, client, myClient, repo, *repo.DefaultBranch)
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []*github.Branch{branch}, nil
 	}
 
-	if branch.Protected != nil && *branch.Protected {
-		fmt.Printf("[OK] %s:%s is already protected\n", *repo.FullName, *branch.Name)
+	var matches []*github.Branch
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		myClient.RateLimiter.Wait(mygithub.CoreCategory)
+		branches, resp, err := client.Repositories.ListBranches(ctx, *repo.Owner.Login, *repo.Name, opt)
+		myClient.RateLimiter.Observe(mygithub.CoreCategory, resp)
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range branches {
+			if rule.MatchesBranch(*b.Name) {
+				matches = append(matches, b)
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return matches, nil
+}
+
+// getBranchWithRetry fetches a single branch, retrying with backoff on a
+// GitHub secondary rate limit.
+func getBranchWithRetry(ctx context.Context, client *github.Client, myClient *mygithub.MyClient, repo *github.Repository, name string) (*github.Branch, *github.Response, error) {
+	var branch *github.Branch
+	var resp *github.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		myClient.RateLimiter.Wait(mygithub.CoreCategory)
+		branch, resp, err = client.Repositories.GetBranch(ctx, *repo.Owner.Login, *repo.Name, name)
+		myClient.RateLimiter.Observe(mygithub.CoreCategory, resp)
+		wait := mygithub.BackoffForResponse(httpResponse(resp), attempt)
+		if wait == 0 {
+			break
+		}
+		logrus.Warnf("%s: secondary rate limited, retrying in %s", *repo.FullName, wait)
+		time.Sleep(wait)
+	}
+	return branch, resp, err
+}
+
+// handleRepoSettings diffs repo-level settings (merge button policy,
+// visibility, default branch, topics, vulnerability alerting) against the
+// resolved policy and, if anything drifted, pushes the desired state in
+// one UpdateRepositorySettings call.
+func handleRepoSettings(ctx context.Context, myClient *mygithub.MyClient, repo *github.Repository, rule *policy.Rule) error {
+	settings := rule.RepositorySettings()
+	var drifts []report.Drift
+
+	reportBool := func(field string, current *bool, desired *bool) {
+		if desired == nil {
+			return
+		}
+		if current != nil && *current == *desired {
+			fmt.Printf("[OK] %s: %s already %t\n", *repo.FullName, field, *desired)
+			return
+		}
+		fmt.Printf("[UPDATE] %s: %s will change to %t\n", *repo.FullName, field, *desired)
+		drifts = append(drifts, report.Drift{Field: field, Current: fmt.Sprintf("%t", current != nil && *current), Desired: fmt.Sprintf("%t", *desired)})
+	}
+
+	reportBool("allow_squash_merge", repo.AllowSquashMerge, settings.AllowSquashMerge)
+	reportBool("allow_merge_commit", repo.AllowMergeCommit, settings.AllowMergeCommit)
+	reportBool("allow_rebase_merge", repo.AllowRebaseMerge, settings.AllowRebaseMerge)
+	reportBool("private", repo.Private, settings.Private)
+
+	if settings.DefaultBranch != nil {
+		if repo.GetDefaultBranch() == *settings.DefaultBranch {
+			fmt.Printf("[OK] %s: default_branch already %s\n", *repo.FullName, *settings.DefaultBranch)
+		} else {
+			fmt.Printf("[UPDATE] %s: default_branch will change to %s\n", *repo.FullName, *settings.DefaultBranch)
+			drifts = append(drifts, report.Drift{Field: "default_branch", Current: repo.GetDefaultBranch(), Desired: *settings.DefaultBranch})
+		}
+	}
+
+	if len(settings.Topics) > 0 {
+		if sameStrings(repo.Topics, settings.Topics) {
+			fmt.Printf("[OK] %s: topics already %v\n", *repo.FullName, settings.Topics)
+		} else {
+			fmt.Printf("[UPDATE] %s: topics will change to %v\n", *repo.FullName, settings.Topics)
+			drifts = append(drifts, report.Drift{Field: "topics", Current: fmt.Sprintf("%v", repo.Topics), Desired: fmt.Sprintf("%v", settings.Topics)})
+		}
+	}
+
+	// GitHub does not surface current vulnerability-alert or
+	// automated-security-fix state on the repository object, so these are
+	// always (re-)applied when the policy sets them. delete_branch_on_merge
+	// joins them here rather than going through reportBool above: the
+	// vendored go-github release this repo is locked to predates that field
+	// on github.Repository, so its current value can't be read back.
+	if settings.DeleteBranchOnMerge != nil {
+		fmt.Printf("[UPDATE] %s: delete_branch_on_merge will be set to %t\n", *repo.FullName, *settings.DeleteBranchOnMerge)
+		drifts = append(drifts, report.Drift{Field: "delete_branch_on_merge", Current: "unknown", Desired: fmt.Sprintf("%t", *settings.DeleteBranchOnMerge)})
+	}
+	if settings.VulnerabilityAlerts != nil {
+		fmt.Printf("[UPDATE] %s: vulnerability_alerts will be set to %t\n", *repo.FullName, *settings.VulnerabilityAlerts)
+		drifts = append(drifts, report.Drift{Field: "vulnerability_alerts", Current: "unknown", Desired: fmt.Sprintf("%t", *settings.VulnerabilityAlerts)})
+	}
+	if settings.AutomatedSecurityFixes != nil {
+		fmt.Printf("[UPDATE] %s: automated_security_fixes will be set to %t\n", *repo.FullName, *settings.AutomatedSecurityFixes)
+		drifts = append(drifts, report.Drift{Field: "automated_security_fixes", Current: "unknown", Desired: fmt.Sprintf("%t", *settings.AutomatedSecurityFixes)})
+	}
+
+	if rpt != nil {
+		rpt.Add(report.Entry{Repo: *repo.FullName, Rule: rule.Repo, Drifts: drifts})
+	}
+
+	if len(drifts) == 0 || dryrun {
+		return nil
+	}
+
+	if _, _, err := myClient.Repositories.UpdateRepositorySettings(ctx, *repo.Owner.Login, *repo.Name, settings); err != nil {
+		return err
+	}
+	fmt.Printf("[UPDATE] %s: repository settings have been updated\n", *repo.FullName)
+	return nil
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	have := make(map[string]bool, len(a))
+	for _, t := range a {
+		have[t] = true
+	}
+	for _, t := range b {
+		if !have[t] {
+			return false
+		}
+	}
+	return true
+}
+
+// httpResponse unwraps the *http.Response embedded in a *github.Response,
+// tolerating a nil resp.
+func httpResponse(resp *github.Response) *http.Response {
+	if resp == nil {
 		return nil
 	}
+	return resp.Response
+}
+
+func handleBranch(ctx context.Context, myClient *mygithub.MyClient, repo *github.Repository, branch *github.Branch, rule *policy.Rule) error {
+	protectionRequest := rule.ProtectionRequest()
+
+	current, resp, err := myClient.Repositories.GetBranchProtection(ctx, *repo.Owner.Login, *repo.Name, *branch.Name)
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return err
+	}
 
-	fmt.Printf("[UPDATE] %s:%s will be changed to protected\n", *repo.FullName, *branch.Name)
+	drifts := diffProtection(current, protectionRequest)
+	if rpt != nil {
+		rpt.Add(report.Entry{Repo: *repo.FullName, Branch: *branch.Name, Rule: rule.Repo, Drifts: drifts})
+	}
+
+	if len(drifts) == 0 {
+		fmt.Printf("[OK] %s:%s already matches the desired protection\n", *repo.FullName, *branch.Name)
+		return nil
+	}
+
+	fmt.Printf("[UPDATE] %s:%s will be changed to match the desired protection\n", *repo.FullName, *branch.Name)
 	if dryrun {
 		// return early
 		return nil
 	}
 
-	// set the branch to be protected
-	b := true
-	branch.Protected = &b
-	if _, _, err := myClient.Repositories.UpdateBranchProtection(ctx, *repo.Owner.Login, *repo.Name, *branch.Name, protectionRequest); err != nil {
-		return err
+	for attempt := 0; ; attempt++ {
+		_, resp, err := myClient.Repositories.UpdateBranchProtection(ctx, *repo.Owner.Login, *repo.Name, *branch.Name, protectionRequest)
+		wait := mygithub.BackoffForResponse(httpResponse(resp), attempt)
+		if wait == 0 {
+			if err != nil {
+				return err
+			}
+			break
+		}
+		logrus.Warnf("%s: secondary rate limited, retrying in %s", *repo.FullName, wait)
+		time.Sleep(wait)
 	}
-	fmt.Printf("[UPDATE] %s:%s has been changed to protected\n", *repo.FullName, *branch.Name)
+	fmt.Printf("[UPDATE] %s:%s has been changed to match the desired protection\n", *repo.FullName, *branch.Name)
 	return nil
 }
 
-func in(a stringSlice, s string) bool {
-	for _, b := range a {
-		if b == s {
-			return true
+// diffProtection reports the fields where current does not yet satisfy
+// desired, so handleBranch can skip a redundant UpdateBranchProtection call
+// and report mode can surface exactly what drifted.
+func diffProtection(current *github.Protection, desired *mygithub.CdisProtectionRequest) []report.Drift {
+	if current == nil {
+		return []report.Drift{{Field: "branch_protection", Current: "none", Desired: "configured"}}
+	}
+
+	var drifts []report.Drift
+
+	if current.EnforceAdmins == nil || current.EnforceAdmins.Enabled != desired.EnforceAdmins {
+		cur := false
+		if current.EnforceAdmins != nil {
+			cur = current.EnforceAdmins.Enabled
+		}
+		drifts = append(drifts, report.Drift{Field: "enforce_admins", Current: fmt.Sprintf("%t", cur), Desired: fmt.Sprintf("%t", desired.EnforceAdmins)})
+	}
+
+	if desired.RequiredPullRequestReviews == nil {
+		if current.RequiredPullRequestReviews != nil {
+			drifts = append(drifts, report.Drift{Field: "required_pull_request_reviews", Current: "configured", Desired: "none"})
 		}
+	} else {
+		cur := current.RequiredPullRequestReviews
+		want := desired.RequiredPullRequestReviews
+		if cur == nil ||
+			cur.DismissStaleReviews != want.DismissStaleReviews ||
+			cur.RequireCodeOwnerReviews != want.RequireCodeOwnerReviews ||
+			cur.RequiredApprovingReviewCount != want.RequiredApprovingReviewCount {
+			curDesc := "none"
+			if cur != nil {
+				curDesc = fmt.Sprintf("dismiss_stale=%t,code_owners=%t,approvals=%d", cur.DismissStaleReviews, cur.RequireCodeOwnerReviews, cur.RequiredApprovingReviewCount)
+			}
+			wantDesc := fmt.Sprintf("dismiss_stale=%t,code_owners=%t,approvals=%d", want.DismissStaleReviews, want.RequireCodeOwnerReviews, want.RequiredApprovingReviewCount)
+			drifts = append(drifts, report.Drift{Field: "required_pull_request_reviews", Current: curDesc, Desired: wantDesc})
+		}
+
+		if cur != nil {
+			if d, ok := diffDismissalRestrictions(cur.DismissalRestrictions, want.DismissalRestrictionsRequest); !ok {
+				drifts = append(drifts, d)
+			}
+		}
+	}
+
+	if desired.RequiredStatusChecks == nil {
+		if current.RequiredStatusChecks != nil {
+			drifts = append(drifts, report.Drift{Field: "required_status_checks", Current: "configured", Desired: "none"})
+		}
+	} else {
+		cur := current.RequiredStatusChecks
+		want := desired.RequiredStatusChecks
+		if cur == nil || cur.Strict != want.Strict || !sameStrings(cur.Contexts, want.Contexts) {
+			curDesc := "none"
+			if cur != nil {
+				curDesc = fmt.Sprintf("strict=%t,contexts=%v", cur.Strict, cur.Contexts)
+			}
+			wantDesc := fmt.Sprintf("strict=%t,contexts=%v", want.Strict, want.Contexts)
+			drifts = append(drifts, report.Drift{Field: "required_status_checks", Current: curDesc, Desired: wantDesc})
+		}
+	}
+
+	if desired.Restrictions == nil {
+		if current.Restrictions != nil {
+			drifts = append(drifts, report.Drift{Field: "restrictions", Current: "configured", Desired: "none"})
+		}
+	} else {
+		cur := current.Restrictions
+		want := desired.Restrictions
+		curUsers, curTeams := "none", "none"
+		if cur != nil {
+			curUsers = fmt.Sprintf("%v", userLogins(cur.Users))
+			curTeams = fmt.Sprintf("%v", teamSlugs(cur.Teams))
+		}
+		if cur == nil || !sameStrings(userLogins(cur.Users), want.Users) || !sameStrings(teamSlugs(cur.Teams), want.Teams) {
+			drifts = append(drifts, report.Drift{
+				Field:   "restrictions",
+				Current: fmt.Sprintf("users=%s,teams=%s", curUsers, curTeams),
+				Desired: fmt.Sprintf("users=%v,teams=%v", want.Users, want.Teams),
+			})
+		}
+	}
+
+	return drifts
+}
+
+// diffDismissalRestrictions compares the review-dismissal restrictions
+// embedded in RequiredPullRequestReviews. It returns (Drift{}, true) when
+// they already match, and the dismissal_restrictions drift with false when
+// they do not.
+func diffDismissalRestrictions(cur github.DismissalRestrictions, want *github.DismissalRestrictionsRequest) (report.Drift, bool) {
+	if want == nil || want.Users == nil {
+		if len(cur.Users) == 0 && len(cur.Teams) == 0 {
+			return report.Drift{}, true
+		}
+		return report.Drift{Field: "dismissal_restrictions", Current: fmt.Sprintf("users=%v,teams=%v", userLogins(cur.Users), teamSlugs(cur.Teams)), Desired: "none"}, false
+	}
+
+	wantUsers, wantTeams := *want.Users, []string(nil)
+	if want.Teams != nil {
+		wantTeams = *want.Teams
+	}
+	curUsers, curTeams := userLogins(cur.Users), teamSlugs(cur.Teams)
+	if sameStrings(curUsers, wantUsers) && sameStrings(curTeams, wantTeams) {
+		return report.Drift{}, true
+	}
+	return report.Drift{
+		Field:   "dismissal_restrictions",
+		Current: fmt.Sprintf("users=%v,teams=%v", curUsers, curTeams),
+		Desired: fmt.Sprintf("users=%v,teams=%v", wantUsers, wantTeams),
+	}, false
+}
+
+func userLogins(users []*github.User) []string {
+	logins := make([]string, 0, len(users))
+	for _, u := range users {
+		logins = append(logins, u.GetLogin())
+	}
+	return logins
+}
+
+func teamSlugs(teams []*github.Team) []string {
+	slugs := make([]string, 0, len(teams))
+	for _, t := range teams {
+		slugs = append(slugs, t.GetSlug())
 	}
-	return false
+	return slugs
 }
 
 func usageAndExit(message string, exitCode int) {
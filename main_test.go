@@ -0,0 +1,210 @@
+// Copyright 2013 The uc-cdis AUTHORS. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/pepper/mygithub"
+)
+
+func users(logins ...string) []*github.User {
+	us := make([]*github.User, 0, len(logins))
+	for _, l := range logins {
+		us = append(us, &github.User{Login: github.String(l)})
+	}
+	return us
+}
+
+func teams(slugs ...string) []*github.Team {
+	ts := make([]*github.Team, 0, len(slugs))
+	for _, s := range slugs {
+		ts = append(ts, &github.Team{Slug: github.String(s)})
+	}
+	return ts
+}
+
+func TestDiffProtectionNoCurrentProtection(t *testing.T) {
+	drifts := diffProtection(nil, &mygithub.CdisProtectionRequest{})
+	if len(drifts) != 1 || drifts[0].Field != "branch_protection" {
+		t.Fatalf("diffProtection(nil, ...) = %+v, want a single branch_protection drift", drifts)
+	}
+}
+
+func TestDiffProtectionMatches(t *testing.T) {
+	current := &github.Protection{
+		EnforceAdmins: &github.AdminEnforcement{Enabled: true},
+		RequiredPullRequestReviews: &github.PullRequestReviewsEnforcement{
+			DismissStaleReviews:          true,
+			RequireCodeOwnerReviews:      true,
+			RequiredApprovingReviewCount: 2,
+			DismissalRestrictions: github.DismissalRestrictions{
+				Users: users("alice"),
+				Teams: teams("leads"),
+			},
+		},
+		RequiredStatusChecks: &github.RequiredStatusChecks{
+			Strict:   true,
+			Contexts: []string{"ci/build", "ci/test"},
+		},
+		Restrictions: &github.BranchRestrictions{
+			Users: users("bob"),
+			Teams: teams("infra"),
+		},
+	}
+
+	desired := &mygithub.CdisProtectionRequest{
+		EnforceAdmins: true,
+		RequiredPullRequestReviews: &mygithub.PullRequestReviewsEnforcementRequest{
+			DismissStaleReviews:          true,
+			RequireCodeOwnerReviews:      true,
+			RequiredApprovingReviewCount: 2,
+			DismissalRestrictionsRequest: &github.DismissalRestrictionsRequest{
+				Users: &[]string{"alice"},
+				Teams: &[]string{"leads"},
+			},
+		},
+		RequiredStatusChecks: &github.RequiredStatusChecks{
+			Strict:   true,
+			Contexts: []string{"ci/test", "ci/build"}, // order should not matter
+		},
+		Restrictions: &github.BranchRestrictionsRequest{
+			Users: []string{"bob"},
+			Teams: []string{"infra"},
+		},
+	}
+
+	if drifts := diffProtection(current, desired); len(drifts) != 0 {
+		t.Errorf("diffProtection() = %+v, want no drift", drifts)
+	}
+}
+
+func TestDiffProtectionDetectsDrift(t *testing.T) {
+	base := func() (*github.Protection, *mygithub.CdisProtectionRequest) {
+		current := &github.Protection{
+			EnforceAdmins: &github.AdminEnforcement{Enabled: true},
+			RequiredPullRequestReviews: &github.PullRequestReviewsEnforcement{
+				RequiredApprovingReviewCount: 1,
+			},
+			RequiredStatusChecks: &github.RequiredStatusChecks{Strict: true, Contexts: []string{"ci/test"}},
+			Restrictions:         &github.BranchRestrictions{Users: users("bob"), Teams: teams("infra")},
+		}
+		desired := &mygithub.CdisProtectionRequest{
+			EnforceAdmins: true,
+			RequiredPullRequestReviews: &mygithub.PullRequestReviewsEnforcementRequest{
+				RequiredApprovingReviewCount: 1,
+			},
+			RequiredStatusChecks: &github.RequiredStatusChecks{Strict: true, Contexts: []string{"ci/test"}},
+			Restrictions:         &github.BranchRestrictionsRequest{Users: []string{"bob"}, Teams: []string{"infra"}},
+		}
+		return current, desired
+	}
+
+	tests := []struct {
+		name      string
+		mutate    func(current *github.Protection, desired *mygithub.CdisProtectionRequest)
+		wantField string
+	}{
+		{
+			name:      "enforce_admins differs",
+			mutate:    func(c *github.Protection, d *mygithub.CdisProtectionRequest) { d.EnforceAdmins = false },
+			wantField: "enforce_admins",
+		},
+		{
+			name: "required_approving_review_count differs",
+			mutate: func(c *github.Protection, d *mygithub.CdisProtectionRequest) {
+				d.RequiredPullRequestReviews.RequiredApprovingReviewCount = 2
+			},
+			wantField: "required_pull_request_reviews",
+		},
+		{
+			name: "required_status_checks contexts differ",
+			mutate: func(c *github.Protection, d *mygithub.CdisProtectionRequest) {
+				d.RequiredStatusChecks.Contexts = []string{"ci/test", "ci/lint"}
+			},
+			wantField: "required_status_checks",
+		},
+		{
+			name: "push restrictions differ",
+			// the exact regression this fix addresses: a policy that only
+			// changes Restrictions must not be reported as drift-free.
+			mutate: func(c *github.Protection, d *mygithub.CdisProtectionRequest) {
+				d.Restrictions.Users = []string{"carol"}
+			},
+			wantField: "restrictions",
+		},
+		{
+			name: "review dismissal restrictions differ",
+			mutate: func(c *github.Protection, d *mygithub.CdisProtectionRequest) {
+				c.RequiredPullRequestReviews.DismissalRestrictions = github.DismissalRestrictions{Users: users("alice")}
+				d.RequiredPullRequestReviews.DismissalRestrictionsRequest = &github.DismissalRestrictionsRequest{
+					Users: &[]string{"dave"},
+					Teams: &[]string{},
+				}
+			},
+			wantField: "dismissal_restrictions",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, desired := base()
+			tt.mutate(current, desired)
+
+			drifts := diffProtection(current, desired)
+			for _, d := range drifts {
+				if d.Field == tt.wantField {
+					return
+				}
+			}
+			t.Errorf("diffProtection() = %+v, want a drift for field %q", drifts, tt.wantField)
+		})
+	}
+}
+
+func TestDiffDismissalRestrictions(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  github.DismissalRestrictions
+		want     *github.DismissalRestrictionsRequest
+		wantSame bool
+	}{
+		{
+			name:     "both unset",
+			current:  github.DismissalRestrictions{},
+			want:     nil,
+			wantSame: true,
+		},
+		{
+			name:     "unset desired but current has restrictions",
+			current:  github.DismissalRestrictions{Users: users("alice")},
+			want:     nil,
+			wantSame: false,
+		},
+		{
+			name:     "matching users and teams",
+			current:  github.DismissalRestrictions{Users: users("alice"), Teams: teams("leads")},
+			want:     &github.DismissalRestrictionsRequest{Users: &[]string{"alice"}, Teams: &[]string{"leads"}},
+			wantSame: true,
+		},
+		{
+			name:     "mismatched teams",
+			current:  github.DismissalRestrictions{Users: users("alice"), Teams: teams("leads")},
+			want:     &github.DismissalRestrictionsRequest{Users: &[]string{"alice"}, Teams: &[]string{"other"}},
+			wantSame: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := diffDismissalRestrictions(tt.current, tt.want)
+			if ok != tt.wantSame {
+				t.Errorf("diffDismissalRestrictions() ok = %v, want %v", ok, tt.wantSame)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2013 The uc-cdis AUTHORS. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mygithub
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+const mediaTypeIntegrationPreview = "application/vnd.github.machine-man-preview+json"
+
+// AppConfig holds the credentials needed to authenticate as a GitHub App
+// installation: the App's numeric ID, the path to its RSA private key (PEM),
+// and the target installation ID. InstallationID may be left zero when the
+// config is only used to list installations.
+type AppConfig struct {
+	AppID          int64
+	PrivateKeyPath string
+	InstallationID int64
+	// BaseURL overrides the default GitHub API base, for GitHub Enterprise.
+	// It must include the trailing slash, e.g. "https://ghe.example.com/api/v3/".
+	BaseURL string
+}
+
+func (c AppConfig) baseURL() string {
+	if c.BaseURL != "" {
+		return c.BaseURL
+	}
+	return defaultBaseURL
+}
+
+// Installation represents a GitHub App installation, as returned by
+// GET /app/installations.
+type Installation struct {
+	ID      int64 `json:"id"`
+	Account struct {
+		Login string `json:"login"`
+	} `json:"account"`
+}
+
+// InstallationTokenSource is an oauth2.TokenSource that mints a GitHub App
+// JWT and exchanges it for a short-lived installation access token. Wrap it
+// in oauth2.ReuseTokenSource so callers transparently get a fresh token once
+// the cached one nears its expiry.
+type InstallationTokenSource struct {
+	cfg        AppConfig
+	key        *rsa.PrivateKey
+	httpClient *http.Client
+}
+
+// NewInstallationTokenSource loads the private key at cfg.PrivateKeyPath and
+// returns a TokenSource that mints installation tokens for
+// cfg.InstallationID. If httpClient is nil, http.DefaultClient is used.
+func NewInstallationTokenSource(cfg AppConfig, httpClient *http.Client) (*InstallationTokenSource, error) {
+	key, err := loadPrivateKey(cfg.PrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &InstallationTokenSource{cfg: cfg, key: key, httpClient: httpClient}, nil
+}
+
+// Token implements oauth2.TokenSource. It mints a fresh App JWT and
+// exchanges it at POST /app/installations/{id}/access_tokens.
+func (s *InstallationTokenSource) Token() (*oauth2.Token, error) {
+	appToken, err := appJWT(s.cfg.AppID, s.key)
+	if err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf("%sapp/installations/%d/access_tokens", s.cfg.baseURL(), s.cfg.InstallationID)
+	req, err := http.NewRequest("POST", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+appToken)
+	req.Header.Set("Accept", mediaTypeIntegrationPreview)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("minting installation token for installation %d: %s: %s", s.cfg.InstallationID, resp.Status, body)
+	}
+
+	var result struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Token{AccessToken: result.Token, Expiry: result.ExpiresAt}, nil
+}
+
+// GetInstallation returns the single installation identified by
+// cfg.InstallationID, authenticating with the App JWT itself rather than an
+// installation token. Callers use this to learn the account an installation
+// token is scoped to, since the token itself carries no user identity.
+func GetInstallation(cfg AppConfig, httpClient *http.Client) (*Installation, error) {
+	key, err := loadPrivateKey(cfg.PrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	appToken, err := appJWT(cfg.AppID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf("%sapp/installations/%d", cfg.baseURL(), cfg.InstallationID)
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+appToken)
+	req.Header.Set("Accept", mediaTypeIntegrationPreview)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("getting installation %d: %s: %s", cfg.InstallationID, resp.Status, body)
+	}
+
+	var installation Installation
+	if err := json.NewDecoder(resp.Body).Decode(&installation); err != nil {
+		return nil, err
+	}
+	return &installation, nil
+}
+
+// ListInstallations returns every installation of the App identified by
+// cfg.AppID/cfg.PrivateKeyPath, authenticating with the App JWT itself
+// rather than an installation token. Use this to auto-discover which orgs
+// and accounts the App is installed on instead of hardcoding an
+// installation ID.
+func ListInstallations(cfg AppConfig, httpClient *http.Client) ([]Installation, error) {
+	key, err := loadPrivateKey(cfg.PrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	appToken, err := appJWT(cfg.AppID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", cfg.baseURL()+"app/installations", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+appToken)
+	req.Header.Set("Accept", mediaTypeIntegrationPreview)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("listing installations: %s: %s", resp.Status, body)
+	}
+
+	var installations []Installation
+	if err := json.NewDecoder(resp.Body).Decode(&installations); err != nil {
+		return nil, err
+	}
+	return installations, nil
+}
+
+func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	pemBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading private key: %v", err)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key: %v", err)
+	}
+	return key, nil
+}
+
+// appJWT mints a short-lived JWT identifying the App, per
+// https://developer.github.com/apps/building-github-apps/authenticating-with-github-apps/
+func appJWT(appID int64, key *rsa.PrivateKey) (string, error) {
+	now := time.Now()
+	claims := jwt.StandardClaims{
+		IssuedAt:  now.Add(-time.Minute).Unix(),
+		ExpiresAt: now.Add(9 * time.Minute).Unix(),
+		Issuer:    fmt.Sprintf("%d", appID),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+}
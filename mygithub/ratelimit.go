@@ -0,0 +1,111 @@
+// Copyright 2013 The uc-cdis AUTHORS. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mygithub
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// RateLimiter tracks GitHub's per-category rate limit quota (core vs.
+// search, per the rateLimitCategory enum) and gates callers so that
+// concurrent workers never collectively exceed it. Share one RateLimiter
+// across every service built on a MyClient.
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets [categories]bucket
+}
+
+type bucket struct {
+	remaining int
+	reset     time.Time
+}
+
+// NewRateLimiter returns a RateLimiter with no known quota yet; the first
+// Observe call for each category seeds its bucket.
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{}
+}
+
+// Observe records the quota reported by resp.Rate for category, so future
+// Wait calls can throttle before the quota is exhausted. It is safe to pass
+// a nil resp.
+func (l *RateLimiter) Observe(category rateLimitCategory, resp *github.Response) {
+	if resp == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buckets[category] = bucket{
+		remaining: resp.Rate.Remaining,
+		reset:     resp.Rate.Reset.Time,
+	}
+}
+
+// Wait blocks until it is safe to make another call in category. It takes
+// one call from the last-observed quota, so concurrent workers cannot all
+// spend the same remaining call, and sleeps until the bucket resets if the
+// quota is exhausted.
+func (l *RateLimiter) Wait(category rateLimitCategory) {
+	l.mu.Lock()
+	b := l.buckets[category]
+	if b.remaining > 0 {
+		l.buckets[category].remaining--
+	}
+	l.mu.Unlock()
+
+	if b.remaining > 0 || b.reset.IsZero() {
+		return
+	}
+	if wait := time.Until(b.reset); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// maxBackoffAttempts bounds how many times BackoffForResponse will tell a
+// caller to keep retrying the same request. Past this, it reports no further
+// backoff (as if the response were not a secondary rate limit at all), so a
+// persistently rate-limited repo can't hang a worker forever, and attempt
+// never grows large enough for jitter's bit shift to overflow a
+// time.Duration.
+const maxBackoffAttempts = 8
+
+// BackoffForResponse returns how long a caller should wait before retrying
+// after resp, or zero if resp does not indicate a secondary rate limit (or
+// the caller has already retried maxBackoffAttempts times). GitHub signals a
+// secondary rate limit with a 403 and a Retry-After header; any other 403
+// (e.g. plain permission denied) is left to the caller to handle and is not
+// retried here. attempt is used to add exponential backoff with jitter on
+// top of any Retry-After value, for the (rare) case the same request is
+// secondary-rate-limited more than once.
+func BackoffForResponse(resp *http.Response, attempt int) time.Duration {
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		return 0
+	}
+	if attempt >= maxBackoffAttempts {
+		return 0
+	}
+	ra := resp.Header.Get("Retry-After")
+	if ra == "" {
+		return 0
+	}
+
+	wait := jitter(attempt)
+	if secs, err := strconv.Atoi(ra); err == nil {
+		wait += time.Duration(secs) * time.Second
+	}
+	return wait
+}
+
+func jitter(attempt int) time.Duration {
+	base := time.Duration(1<<uint(attempt)) * time.Second
+	return base + time.Duration(rand.Int63n(int64(base/2+1)))
+}
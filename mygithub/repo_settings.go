@@ -0,0 +1,152 @@
+// Copyright 2013 The uc-cdis AUTHORS. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mygithub
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	mediaTypeVulnerabilityAlertsPreview    = "application/vnd.github.dorian-preview+json"
+	mediaTypeAutomatedSecurityFixesPreview = "application/vnd.github.london-preview+json"
+	mediaTypeTopicsPreview                 = "application/vnd.github.mercy-preview+json"
+)
+
+// CdisRepositorySettings represents the repo-level settings pepper enforces
+// beyond branch protection: merge button policy, visibility, default
+// branch, topics, and vulnerability alerting. Fields left nil (or, for
+// Topics, empty) are left untouched.
+type CdisRepositorySettings struct {
+	DefaultBranch       *string `json:"default_branch,omitempty"`
+	Private             *bool   `json:"private,omitempty"`
+	AllowSquashMerge    *bool   `json:"allow_squash_merge,omitempty"`
+	AllowMergeCommit    *bool   `json:"allow_merge_commit,omitempty"`
+	AllowRebaseMerge    *bool   `json:"allow_rebase_merge,omitempty"`
+	DeleteBranchOnMerge *bool   `json:"delete_branch_on_merge,omitempty"`
+
+	// Topics, VulnerabilityAlerts and AutomatedSecurityFixes are driven
+	// through their own endpoints rather than the repo PATCH body, so they
+	// are excluded from the JSON the PATCH request sends.
+	Topics                 []string `json:"-"`
+	VulnerabilityAlerts    *bool    `json:"-"`
+	AutomatedSecurityFixes *bool    `json:"-"`
+}
+
+// UpdateRepositorySettings PATCHes the repo-level settings in settings,
+// then pushes Topics and the vulnerability alert / automated security fix
+// state through their dedicated endpoints, if set.
+//
+// GitHub API docs:
+//
+//	https://developer.github.com/v3/repos/#edit
+//	https://developer.github.com/v3/repos/#replace-all-topics-for-a-repository
+//	https://developer.github.com/v3/repos/#enable-vulnerability-alerts
+//	https://developer.github.com/v3/repos/#enable-automated-security-fixes
+func (s *MyRepositoriesService) UpdateRepositorySettings(ctx context.Context, owner, repo string, settings *CdisRepositorySettings) (*github.Repository, *github.Response, error) {
+	u := fmt.Sprintf("repos/%v/%v", owner, repo)
+	req, err := s.client.client.NewRequest("PATCH", u, settings)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.client.RateLimiter.Wait(CoreCategory)
+	r := new(github.Repository)
+	resp, err := s.client.client.Do(ctx, req, r)
+	s.client.RateLimiter.Observe(CoreCategory, resp)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	if len(settings.Topics) > 0 {
+		if _, err := s.replaceTopics(ctx, owner, repo, settings.Topics); err != nil {
+			return r, resp, err
+		}
+	}
+
+	if settings.VulnerabilityAlerts != nil {
+		if _, err := s.setVulnerabilityAlerts(ctx, owner, repo, *settings.VulnerabilityAlerts); err != nil {
+			return r, resp, err
+		}
+	}
+
+	if settings.AutomatedSecurityFixes != nil {
+		if _, err := s.setAutomatedSecurityFixes(ctx, owner, repo, *settings.AutomatedSecurityFixes); err != nil {
+			return r, resp, err
+		}
+	}
+
+	return r, resp, nil
+}
+
+// replaceTopics sets the full topic list for a repo.
+//
+// GitHub API docs: https://developer.github.com/v3/repos/#replace-all-topics-for-a-repository
+func (s *MyRepositoriesService) replaceTopics(ctx context.Context, owner, repo string, topics []string) (*github.Response, error) {
+	u := fmt.Sprintf("repos/%v/%v/topics", owner, repo)
+	body := &struct {
+		Names []string `json:"names"`
+	}{Names: topics}
+
+	req, err := s.client.client.NewRequest("PUT", u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaTypeTopicsPreview)
+
+	s.client.RateLimiter.Wait(CoreCategory)
+	resp, err := s.client.client.Do(ctx, req, nil)
+	s.client.RateLimiter.Observe(CoreCategory, resp)
+	return resp, err
+}
+
+// setVulnerabilityAlerts enables or disables Dependabot vulnerability
+// alerts for a repo.
+//
+// GitHub API docs: https://developer.github.com/v3/repos/#enable-vulnerability-alerts
+func (s *MyRepositoriesService) setVulnerabilityAlerts(ctx context.Context, owner, repo string, enabled bool) (*github.Response, error) {
+	method := "PUT"
+	if !enabled {
+		method = "DELETE"
+	}
+	u := fmt.Sprintf("repos/%v/%v/vulnerability-alerts", owner, repo)
+
+	req, err := s.client.client.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaTypeVulnerabilityAlertsPreview)
+
+	s.client.RateLimiter.Wait(CoreCategory)
+	resp, err := s.client.client.Do(ctx, req, nil)
+	s.client.RateLimiter.Observe(CoreCategory, resp)
+	return resp, err
+}
+
+// setAutomatedSecurityFixes enables or disables Dependabot security
+// updates for a repo.
+//
+// GitHub API docs: https://developer.github.com/v3/repos/#enable-automated-security-fixes
+func (s *MyRepositoriesService) setAutomatedSecurityFixes(ctx context.Context, owner, repo string, enabled bool) (*github.Response, error) {
+	method := "PUT"
+	if !enabled {
+		method = "DELETE"
+	}
+	u := fmt.Sprintf("repos/%v/%v/automated-security-fixes", owner, repo)
+
+	req, err := s.client.client.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaTypeAutomatedSecurityFixesPreview)
+
+	s.client.RateLimiter.Wait(CoreCategory)
+	resp, err := s.client.client.Do(ctx, req, nil)
+	s.client.RateLimiter.Observe(CoreCategory, resp)
+	return resp, err
+}
@@ -9,6 +9,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
 
 	"github.com/google/go-github/github"
 )
@@ -26,6 +27,9 @@ type MyClient struct {
 	client       *github.Client // HTTP client used to communicate with the API.
 	common       myservice      // Reuse a single struct instead of allocating one for each service on the heap.
 	Repositories *MyRepositoriesService
+	// RateLimiter is shared by every service built on this client, so
+	// concurrent callers never collectively exceed GitHub's quota.
+	RateLimiter *RateLimiter
 }
 
 type myservice struct {
@@ -40,12 +44,20 @@ const (
 	categories // An array of this length will be able to contain all rate limit categories.
 )
 
+// CoreCategory and SearchCategory let callers outside this package gate
+// RateLimiter.Wait on the same quota GitHub tracks separately per the
+// "core" and "search" API families.
+const (
+	CoreCategory   = coreCategory
+	SearchCategory = searchCategory
+)
+
 // NewClient returns a new GitHub API client. If a nil httpClient is
 // provided, http.DefaultClient will be used. To use API methods which require
 // authentication, provide an http.Client that will perform the authentication
 // for you (such as that provided by the golang.org/x/oauth2 library).
 func NewClient(client *github.Client) *MyClient {
-	c := &MyClient{client: client}
+	c := &MyClient{client: client, RateLimiter: NewRateLimiter()}
 	c.common.client = c
 	c.Repositories = (*MyRepositoriesService)(&c.common)
 	return c
@@ -76,6 +88,8 @@ type PullRequestReviewsEnforcementRequest struct {
 	DismissStaleReviews bool `json:"dismiss_stale_reviews"`
 	// RequireCodeOwnerReviews specifies if an approved review is required in pull requests including files with a designated code owner.
 	RequireCodeOwnerReviews bool `json:"require_code_owner_reviews"`
+	// RequiredApprovingReviewCount specifies the number of approving reviews required before a pull request can be merged.
+	RequiredApprovingReviewCount int `json:"required_approving_review_count"`
 }
 
 // MarshalJSON implements the json.Marshaler interface.
@@ -85,9 +99,11 @@ func (req PullRequestReviewsEnforcementRequest) MarshalJSON() ([]byte, error) {
 		newReq := struct {
 			D bool `json:"dismiss_stale_reviews"`
 			O bool `json:"require_code_owner_reviews"`
+			C int  `json:"required_approving_review_count"`
 		}{
 			D: req.DismissStaleReviews,
 			O: req.RequireCodeOwnerReviews,
+			C: req.RequiredApprovingReviewCount,
 		}
 		return json.Marshal(newReq)
 	}
@@ -95,10 +111,12 @@ func (req PullRequestReviewsEnforcementRequest) MarshalJSON() ([]byte, error) {
 		R *github.DismissalRestrictionsRequest `json:"dismissal_restrictions"`
 		D bool                                 `json:"dismiss_stale_reviews"`
 		O bool                                 `json:"require_code_owner_reviews"`
+		C int                                  `json:"required_approving_review_count"`
 	}{
 		R: req.DismissalRestrictionsRequest,
 		D: req.DismissStaleReviews,
 		O: req.RequireCodeOwnerReviews,
+		C: req.RequiredApprovingReviewCount,
 	}
 	return json.Marshal(newReq)
 }
@@ -107,7 +125,7 @@ func (req PullRequestReviewsEnforcementRequest) MarshalJSON() ([]byte, error) {
 //
 // GitHub API docs: https://developer.github.com/v3/repos/branches/#update-branch-protection
 func (s *MyRepositoriesService) UpdateBranchProtection(ctx context.Context, owner, repo, branch string, preq *CdisProtectionRequest) (*github.Protection, *github.Response, error) {
-	u := fmt.Sprintf("repos/%v/%v/branches/%v/protection", owner, repo, branch)
+	u := fmt.Sprintf("repos/%v/%v/branches/%v/protection", owner, repo, url.PathEscape(branch))
 	req, err := s.client.client.NewRequest("PUT", u, preq)
 	if err != nil {
 		return nil, nil, err
@@ -116,8 +134,36 @@ func (s *MyRepositoriesService) UpdateBranchProtection(ctx context.Context, owne
 	// TODO: remove custom Accept header when this API fully launches
 	req.Header.Set("Accept", mediaTypeProtectedBranchesPreview)
 
+	s.client.RateLimiter.Wait(CoreCategory)
+	p := new(github.Protection)
+	resp, err := s.client.client.Do(ctx, req, p)
+	s.client.RateLimiter.Observe(CoreCategory, resp)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	return p, resp, nil
+}
+
+// GetBranchProtection returns the current protection settings for a
+// branch, so callers can diff them against a desired CdisProtectionRequest
+// and skip a redundant UpdateBranchProtection call.
+//
+// GitHub API docs: https://developer.github.com/v3/repos/branches/#get-branch-protection
+func (s *MyRepositoriesService) GetBranchProtection(ctx context.Context, owner, repo, branch string) (*github.Protection, *github.Response, error) {
+	u := fmt.Sprintf("repos/%v/%v/branches/%v/protection", owner, repo, url.PathEscape(branch))
+	req, err := s.client.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// TODO: remove custom Accept header when this API fully launches
+	req.Header.Set("Accept", mediaTypeProtectedBranchesPreview)
+
+	s.client.RateLimiter.Wait(CoreCategory)
 	p := new(github.Protection)
 	resp, err := s.client.client.Do(ctx, req, p)
+	s.client.RateLimiter.Observe(CoreCategory, resp)
 	if err != nil {
 		return nil, resp, err
 	}
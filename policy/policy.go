@@ -0,0 +1,224 @@
+// Copyright 2013 The uc-cdis AUTHORS. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package policy loads a declarative branch-protection policy file and
+// resolves the effective rule for a given repository, so that ops can
+// change protection rules without recompiling pepper.
+package policy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"github.com/google/go-github/github"
+	"github.com/pepper/mygithub"
+	"gopkg.in/yaml.v2"
+)
+
+// Policy is the top-level configuration loaded from a YAML (or JSON, which
+// is valid YAML) policy file.
+type Policy struct {
+	// Exceptions lists owner/name globs (e.g. "myorg/legacy-*") that are
+	// skipped entirely, regardless of Rules.
+	Exceptions []string `yaml:"exceptions" json:"exceptions"`
+	// Rules are evaluated in order; the first rule whose selectors match a
+	// repo is its effective policy.
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// Rule targets repositories by owner/name glob and, optionally, topic or
+// language, and carries the branch protection to apply to matching repos.
+type Rule struct {
+	// Repo is an owner/name glob, e.g. "uc-cdis/*" or "uc-cdis/pepper".
+	Repo string `yaml:"repo" json:"repo"`
+	// Topics, if set, requires the repo to have at least one matching topic.
+	Topics []string `yaml:"topics,omitempty" json:"topics,omitempty"`
+	// Languages, if set, requires the repo's primary language to match one.
+	Languages []string `yaml:"languages,omitempty" json:"languages,omitempty"`
+
+	// Branches lists the branch selectors (literal names or globs like
+	// "release/*", "hotfix-*") this rule's protection applies to. If empty,
+	// only the repo's default branch is protected.
+	Branches []string `yaml:"branches,omitempty" json:"branches,omitempty"`
+
+	RequiredStatusChecks       *StatusChecks `yaml:"required_status_checks,omitempty" json:"required_status_checks,omitempty"`
+	RequiredPullRequestReviews *Reviews      `yaml:"required_pull_request_reviews,omitempty" json:"required_pull_request_reviews,omitempty"`
+	EnforceAdmins              bool          `yaml:"enforce_admins" json:"enforce_admins"`
+	Restrictions               *Restrictions `yaml:"restrictions,omitempty" json:"restrictions,omitempty"`
+
+	// Repo-level settings, enforced independently of branch protection.
+	DefaultBranch          string   `yaml:"default_branch,omitempty" json:"default_branch,omitempty"`
+	Private                *bool    `yaml:"private,omitempty" json:"private,omitempty"`
+	AllowSquashMerge       *bool    `yaml:"allow_squash_merge,omitempty" json:"allow_squash_merge,omitempty"`
+	AllowMergeCommit       *bool    `yaml:"allow_merge_commit,omitempty" json:"allow_merge_commit,omitempty"`
+	AllowRebaseMerge       *bool    `yaml:"allow_rebase_merge,omitempty" json:"allow_rebase_merge,omitempty"`
+	DeleteBranchOnMerge    *bool    `yaml:"delete_branch_on_merge,omitempty" json:"delete_branch_on_merge,omitempty"`
+	RepoTopics             []string `yaml:"repo_topics,omitempty" json:"repo_topics,omitempty"`
+	VulnerabilityAlerts    *bool    `yaml:"vulnerability_alerts,omitempty" json:"vulnerability_alerts,omitempty"`
+	AutomatedSecurityFixes *bool    `yaml:"automated_security_fixes,omitempty" json:"automated_security_fixes,omitempty"`
+}
+
+// StatusChecks mirrors github.RequiredStatusChecks in policy-file form.
+type StatusChecks struct {
+	Strict   bool     `yaml:"strict" json:"strict"`
+	Contexts []string `yaml:"contexts" json:"contexts"`
+}
+
+// Reviews mirrors mygithub.PullRequestReviewsEnforcementRequest in
+// policy-file form.
+type Reviews struct {
+	DismissStaleReviews          bool          `yaml:"dismiss_stale_reviews" json:"dismiss_stale_reviews"`
+	RequireCodeOwnerReviews      bool          `yaml:"require_code_owner_reviews" json:"require_code_owner_reviews"`
+	RequiredApprovingReviewCount int           `yaml:"required_approving_review_count" json:"required_approving_review_count"`
+	DismissalRestrictions        *Restrictions `yaml:"dismissal_restrictions,omitempty" json:"dismissal_restrictions,omitempty"`
+}
+
+// Restrictions mirrors github.BranchRestrictionsRequest in policy-file form.
+type Restrictions struct {
+	Users []string `yaml:"users,omitempty" json:"users,omitempty"`
+	Teams []string `yaml:"teams,omitempty" json:"teams,omitempty"`
+}
+
+// Load reads and parses the policy file at the given path.
+func Load(file string) (*Policy, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("parsing policy file %s: %v", file, err)
+	}
+	return p, nil
+}
+
+// Excluded reports whether fullName (owner/repo) matches an exceptions glob.
+func (p *Policy) Excluded(fullName string) bool {
+	for _, pattern := range p.Exceptions {
+		if ok, _ := path.Match(pattern, fullName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the effective rule for repo and true, or false if no rule
+// matches and the repo should be left untouched.
+func (p *Policy) Resolve(repo *github.Repository) (*Rule, bool) {
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.matches(repo) {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+func (r *Rule) matches(repo *github.Repository) bool {
+	if r.Repo != "" {
+		ok, err := path.Match(r.Repo, repo.GetFullName())
+		if err != nil || !ok {
+			return false
+		}
+	}
+	if len(r.Topics) > 0 && !anyTopicMatches(r.Topics, repo.Topics) {
+		return false
+	}
+	if len(r.Languages) > 0 && !contains(r.Languages, repo.GetLanguage()) {
+		return false
+	}
+	return true
+}
+
+// MatchesBranch reports whether name matches one of the rule's branch
+// selectors. It returns false (nothing to protect beyond the default
+// branch) when the rule declares no selectors at all.
+func (r *Rule) MatchesBranch(name string) bool {
+	for _, selector := range r.Branches {
+		if ok, err := path.Match(selector, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+func anyTopicMatches(want, have []string) bool {
+	for _, w := range want {
+		if contains(have, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
+
+// ProtectionRequest converts the rule into the shape
+// MyRepositoriesService.UpdateBranchProtection expects.
+func (r *Rule) ProtectionRequest() *mygithub.CdisProtectionRequest {
+	req := &mygithub.CdisProtectionRequest{
+		EnforceAdmins: r.EnforceAdmins,
+	}
+
+	if r.RequiredStatusChecks != nil {
+		req.RequiredStatusChecks = &github.RequiredStatusChecks{
+			Strict:   r.RequiredStatusChecks.Strict,
+			Contexts: r.RequiredStatusChecks.Contexts,
+		}
+	}
+
+	if r.RequiredPullRequestReviews != nil {
+		reviews := &mygithub.PullRequestReviewsEnforcementRequest{
+			DismissStaleReviews:          r.RequiredPullRequestReviews.DismissStaleReviews,
+			RequireCodeOwnerReviews:      r.RequiredPullRequestReviews.RequireCodeOwnerReviews,
+			RequiredApprovingReviewCount: r.RequiredPullRequestReviews.RequiredApprovingReviewCount,
+		}
+		if dr := r.RequiredPullRequestReviews.DismissalRestrictions; dr != nil {
+			reviews.DismissalRestrictionsRequest = &github.DismissalRestrictionsRequest{
+				Users: &dr.Users,
+				Teams: &dr.Teams,
+			}
+		}
+		req.RequiredPullRequestReviews = reviews
+	}
+
+	if r.Restrictions != nil {
+		req.Restrictions = &github.BranchRestrictionsRequest{
+			Users: r.Restrictions.Users,
+			Teams: r.Restrictions.Teams,
+		}
+	}
+
+	return req
+}
+
+// RepositorySettings converts the rule's repo-level fields into the shape
+// MyRepositoriesService.UpdateRepositorySettings expects.
+func (r *Rule) RepositorySettings() *mygithub.CdisRepositorySettings {
+	settings := &mygithub.CdisRepositorySettings{
+		Private:                r.Private,
+		AllowSquashMerge:       r.AllowSquashMerge,
+		AllowMergeCommit:       r.AllowMergeCommit,
+		AllowRebaseMerge:       r.AllowRebaseMerge,
+		DeleteBranchOnMerge:    r.DeleteBranchOnMerge,
+		VulnerabilityAlerts:    r.VulnerabilityAlerts,
+		AutomatedSecurityFixes: r.AutomatedSecurityFixes,
+	}
+	if r.DefaultBranch != "" {
+		settings.DefaultBranch = &r.DefaultBranch
+	}
+	if len(r.RepoTopics) > 0 {
+		settings.Topics = r.RepoTopics
+	}
+	return settings
+}
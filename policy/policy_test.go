@@ -0,0 +1,158 @@
+// Copyright 2013 The uc-cdis AUTHORS. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package policy
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func repo(fullName, language string, topics []string) *github.Repository {
+	return &github.Repository{
+		FullName: &fullName,
+		Language: &language,
+		Topics:   topics,
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		repo *github.Repository
+		want bool
+	}{
+		{
+			name: "repo glob matches",
+			rule: Rule{Repo: "uc-cdis/*"},
+			repo: repo("uc-cdis/pepper", "Go", nil),
+			want: true,
+		},
+		{
+			name: "repo glob does not match",
+			rule: Rule{Repo: "uc-cdis/*"},
+			repo: repo("other-org/pepper", "Go", nil),
+			want: false,
+		},
+		{
+			name: "topic required and present",
+			rule: Rule{Topics: []string{"compliance"}},
+			repo: repo("uc-cdis/pepper", "Go", []string{"compliance", "infra"}),
+			want: true,
+		},
+		{
+			name: "topic required but absent",
+			rule: Rule{Topics: []string{"compliance"}},
+			repo: repo("uc-cdis/pepper", "Go", []string{"infra"}),
+			want: false,
+		},
+		{
+			name: "language required and matches",
+			rule: Rule{Languages: []string{"Go", "Python"}},
+			repo: repo("uc-cdis/pepper", "Go", nil),
+			want: true,
+		},
+		{
+			name: "language required but does not match",
+			rule: Rule{Languages: []string{"Python"}},
+			repo: repo("uc-cdis/pepper", "Go", nil),
+			want: false,
+		},
+		{
+			name: "no selectors always matches",
+			rule: Rule{},
+			repo: repo("uc-cdis/pepper", "Go", nil),
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.matches(tt.repo); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleMatchesBranch(t *testing.T) {
+	tests := []struct {
+		name     string
+		branches []string
+		branch   string
+		want     bool
+	}{
+		{name: "no selectors matches nothing", branches: nil, branch: "master", want: false},
+		{name: "literal match", branches: []string{"master"}, branch: "master", want: true},
+		{name: "literal mismatch", branches: []string{"master"}, branch: "develop", want: false},
+		{name: "glob match", branches: []string{"release/*"}, branch: "release/1.0", want: true},
+		{name: "glob mismatch", branches: []string{"release/*"}, branch: "hotfix/1.0", want: false},
+		{name: "second selector matches", branches: []string{"master", "release/*"}, branch: "release/2.0", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Rule{Branches: tt.branches}
+			if got := r.MatchesBranch(tt.branch); got != tt.want {
+				t.Errorf("MatchesBranch(%q) = %v, want %v", tt.branch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyResolve(t *testing.T) {
+	// EnforceAdmins doubles as a marker here so the test can tell the
+	// compliance rule (rule 1) apart from rules 0 and 2, independent of their
+	// Repo globs.
+	p := &Policy{
+		Rules: []Rule{
+			{Repo: "uc-cdis/legacy-*", EnforceAdmins: false},
+			{Repo: "uc-cdis/*", Topics: []string{"compliance"}, EnforceAdmins: true},
+			{Repo: "uc-cdis/*", EnforceAdmins: false},
+		},
+	}
+
+	tests := []struct {
+		name              string
+		repo              *github.Repository
+		wantOK            bool
+		wantEnforceAdmins bool
+	}{
+		{
+			name: "first matching rule wins",
+			// also satisfies rule 1's Repo glob and Topics selector, so this
+			// proves rule 1 is not picked over the earlier rule 0, even
+			// though rule 1 also matches.
+			repo:              repo("uc-cdis/legacy-api", "Go", []string{"compliance"}),
+			wantOK:            true,
+			wantEnforceAdmins: false,
+		},
+		{
+			name:              "later rule used when earlier rule's selectors fail",
+			repo:              repo("uc-cdis/pepper", "Go", []string{"compliance"}),
+			wantOK:            true,
+			wantEnforceAdmins: true,
+		},
+		{
+			name:   "no rule matches",
+			repo:   repo("other-org/pepper", "Go", nil),
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, ok := p.Resolve(tt.repo)
+			if ok != tt.wantOK {
+				t.Fatalf("Resolve() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && rule.EnforceAdmins != tt.wantEnforceAdmins {
+				t.Errorf("Resolve() matched rule with EnforceAdmins = %v, want %v", rule.EnforceAdmins, tt.wantEnforceAdmins)
+			}
+		})
+	}
+}
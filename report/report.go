@@ -0,0 +1,193 @@
+// Copyright 2013 The uc-cdis AUTHORS. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package report renders the drift between a repo or branch's actual
+// GitHub state and its resolved policy as JSON, CSV, or SARIF, so pepper
+// can run as a CI compliance gate instead of only a mutation tool.
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Drift describes one field where the actual GitHub state differs from
+// the policy's desired state.
+type Drift struct {
+	Field   string `json:"field"`
+	Current string `json:"current"`
+	Desired string `json:"desired"`
+}
+
+// String renders a drift as "field: current->desired", e.g.
+// "enforce_admins: false->true".
+func (d Drift) String() string {
+	return fmt.Sprintf("%s: %s->%s", d.Field, d.Current, d.Desired)
+}
+
+// Entry is the drift observed for one repo, or one branch within a repo
+// when Branch is set. Rule identifies which policy rule it was resolved
+// against.
+type Entry struct {
+	Repo   string  `json:"repo"`
+	Branch string  `json:"branch,omitempty"`
+	Rule   string  `json:"rule,omitempty"`
+	Drifts []Drift `json:"drifts"`
+}
+
+// Report accumulates Entries from concurrent workers and renders them in
+// json, csv, or sarif format.
+type Report struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// New returns an empty Report.
+func New() *Report {
+	return &Report{}
+}
+
+// Add records entry, unless it has no drift to report. Safe to call from
+// multiple goroutines.
+func (r *Report) Add(entry Entry) {
+	if len(entry.Drifts) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+// Write renders the report in the given format ("json", "csv", or
+// "sarif") to w.
+func (r *Report) Write(w io.Writer, format string) error {
+	r.mu.Lock()
+	entries := make([]Entry, len(r.entries))
+	copy(entries, r.entries)
+	r.mu.Unlock()
+
+	switch format {
+	case "json":
+		return writeJSON(w, entries)
+	case "csv":
+		return writeCSV(w, entries)
+	case "sarif":
+		return writeSARIF(w, entries)
+	default:
+		return fmt.Errorf("unknown report format %q", format)
+	}
+}
+
+func writeJSON(w io.Writer, entries []Entry) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+func writeCSV(w io.Writer, entries []Entry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"repo", "branch", "rule", "field", "current", "desired"}); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		for _, d := range e.Drifts {
+			row := []string{e.Repo, e.Branch, e.Rule, d.Field, d.Current, d.Desired}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// sarifLog mirrors the minimal subset of the SARIF 2.1.0 schema pepper
+// needs in order to upload drift as GitHub code-scanning results.
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+func writeSARIF(w io.Writer, entries []Entry) error {
+	seenRules := map[string]bool{}
+	run := sarifRun{Tool: sarifTool{Driver: sarifDriver{Name: "pepper"}}}
+
+	for _, e := range entries {
+		loc := e.Repo
+		if e.Branch != "" {
+			loc = fmt.Sprintf("%s:%s", e.Repo, e.Branch)
+		}
+		for _, d := range e.Drifts {
+			seenRules[d.Field] = true
+			run.Results = append(run.Results, sarifResult{
+				RuleID:  d.Field,
+				Message: sarifMessage{Text: d.String()},
+				Locations: []sarifLocation{{
+					LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: loc}},
+				}},
+			})
+		}
+	}
+
+	ruleIDs := make([]string, 0, len(seenRules))
+	for id := range seenRules {
+		ruleIDs = append(ruleIDs, id)
+	}
+	sort.Strings(ruleIDs)
+	for _, id := range ruleIDs {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: id})
+	}
+
+	log := sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json",
+		Runs:    []sarifRun{run},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
@@ -0,0 +1,128 @@
+// Copyright 2013 The uc-cdis AUTHORS. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func sampleReport() *Report {
+	r := New()
+	r.Add(Entry{Repo: "uc-cdis/pepper", Drifts: nil}) // no drift: must not be recorded
+	r.Add(Entry{
+		Repo:   "uc-cdis/pepper",
+		Branch: "master",
+		Rule:   "uc-cdis/*",
+		Drifts: []Drift{{Field: "enforce_admins", Current: "false", Desired: "true"}},
+	})
+	r.Add(Entry{
+		Repo:   "uc-cdis/other",
+		Rule:   "uc-cdis/*",
+		Drifts: []Drift{{Field: "private", Current: "false", Desired: "true"}},
+	})
+	return r
+}
+
+func TestReportAddSkipsDriftlessEntries(t *testing.T) {
+	r := sampleReport()
+	if got := len(r.entries); got != 2 {
+		t.Fatalf("len(entries) = %d, want 2 (the driftless Add should have been skipped)", got)
+	}
+}
+
+func TestReportWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := sampleReport().Write(&buf, "json"); err != nil {
+		t.Fatalf("Write(json) = %v", err)
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(buf.Bytes(), &entries); err != nil {
+		t.Fatalf("unmarshaling JSON output: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if entries[0].Branch != "master" || entries[0].Drifts[0].Field != "enforce_admins" {
+		t.Errorf("entries[0] = %+v, want the master branch enforce_admins drift", entries[0])
+	}
+}
+
+func TestReportWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := sampleReport().Write(&buf, "csv"); err != nil {
+		t.Fatalf("Write(csv) = %v", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("reading CSV output: %v", err)
+	}
+	// header + one row per drift
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3 (1 header + 2 drifts)", len(rows))
+	}
+	if got, want := rows[0], []string{"repo", "branch", "rule", "field", "current", "desired"}; !equalRows(got, want) {
+		t.Errorf("header = %v, want %v", got, want)
+	}
+	if rows[1][3] != "enforce_admins" {
+		t.Errorf("rows[1][3] = %q, want %q", rows[1][3], "enforce_admins")
+	}
+}
+
+func TestReportWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := sampleReport().Write(&buf, "sarif"); err != nil {
+		t.Fatalf("Write(sarif) = %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("unmarshaling SARIF output: %v", err)
+	}
+	if log.Version != "2.1.0" {
+		t.Errorf("Version = %q, want 2.1.0", log.Version)
+	}
+	if len(log.Runs) != 1 {
+		t.Fatalf("got %d runs, want 1", len(log.Runs))
+	}
+	run := log.Runs[0]
+	if run.Tool.Driver.Name != "pepper" {
+		t.Errorf("driver name = %q, want pepper", run.Tool.Driver.Name)
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("got %d results, want 2", len(run.Results))
+	}
+	if !strings.Contains(run.Results[0].Message.Text, "->") {
+		t.Errorf("result message %q does not look like a rendered Drift", run.Results[0].Message.Text)
+	}
+	// rule IDs are deduped and sorted
+	if len(run.Tool.Driver.Rules) != 2 || run.Tool.Driver.Rules[0].ID != "enforce_admins" {
+		t.Errorf("rules = %+v, want [enforce_admins private]", run.Tool.Driver.Rules)
+	}
+}
+
+func TestReportWriteUnknownFormat(t *testing.T) {
+	if err := sampleReport().Write(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("Write(xml) = nil error, want an error for an unknown format")
+	}
+}
+
+func equalRows(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}